@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// batchTimer is a pending window close that can be cancelled
+type batchTimer interface {
+	Stop() bool
+}
+
+// joinBatch is one channel's open window
+type joinBatch struct {
+	members []*discordgo.Member
+	timer   batchTimer
+	flush   func(members []*discordgo.Member)
+}
+
+// joinBatcher collects joins per voice channel so an event starting doesn't post one notification per person
+type joinBatcher struct {
+	mut       sync.Mutex
+	logger    *slog.Logger
+	afterFunc func(d time.Duration, f func()) batchTimer
+	pending   map[string]*joinBatch
+}
+
+func newJoinBatcher(logger *slog.Logger) *joinBatcher {
+	return &joinBatcher{
+		logger: logger,
+		afterFunc: func(d time.Duration, f func()) batchTimer {
+			return time.AfterFunc(d, f)
+		},
+		pending: map[string]*joinBatch{},
+	}
+}
+
+// Add queues member for the channel. The first join in a channel opens a window, when it closes flush is called with
+// everyone who joined during it.
+func (b *joinBatcher) Add(channelID string, window time.Duration, member *discordgo.Member, flush func(members []*discordgo.Member)) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if batch, open := b.pending[channelID]; open {
+		batch.members = append(batch.members, member)
+		return
+	}
+
+	batch := &joinBatch{members: []*discordgo.Member{member}, flush: flush}
+	b.pending[channelID] = batch
+	batch.timer = b.afterFunc(window, func() {
+		b.mut.Lock()
+		//Flush may have taken this batch already and a new one opened in its place
+		if b.pending[channelID] != batch {
+			b.mut.Unlock()
+			return
+		}
+		delete(b.pending, channelID)
+		b.mut.Unlock()
+
+		b.run(channelID, batch)
+	})
+}
+
+// Flush closes every open window now, for shutdown so joins in the last few seconds still get announced
+func (b *joinBatcher) Flush() {
+	b.mut.Lock()
+	pending := b.pending
+	b.pending = map[string]*joinBatch{}
+	b.mut.Unlock()
+
+	for channelID, batch := range pending {
+		batch.timer.Stop()
+		b.run(channelID, batch)
+	}
+}
+
+// run calls the batch's flush, recovering a panic since timer goroutines are outside discordgo's handler recovery
+func (b *joinBatcher) run(channelID string, batch *joinBatch) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.logger.Error("recovered from join batch flush panic", slog.Any("panic", r), slog.String("channel", channelID), slog.String("stack", string(debug.Stack())))
+		}
+	}()
+	batch.flush(batch.members)
+}
+
+func buildBatchNotificationMessage(c config, members []*discordgo.Member, channelID string, channels channelLookup, logger *slog.Logger) (string, error) {
+	channel, err := channels(channelID)
+	if err != nil {
+		return "", err
+	}
+
+	return renderNotification(c, members, channel, logger), nil
+}
+
+// joinNames lists names in prose, collapsing anyone past the second into a count once there are more than three
+func joinNames(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	case 2:
+		return names[0] + " and " + names[1]
+	case 3:
+		return names[0] + ", " + names[1] + ", and " + names[2]
+	default:
+		return fmt.Sprintf("%s, %s, and %d others", names[0], names[1], len(names)-2)
+	}
+}
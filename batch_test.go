@@ -0,0 +1,152 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeTimers records windows instead of starting real timers, fire closes one by hand
+type fakeTimers struct {
+	funcs   []func()
+	stopped []bool
+}
+
+type fakeTimer struct {
+	timers *fakeTimers
+	index  int
+}
+
+func (t fakeTimer) Stop() bool {
+	stopped := t.timers.stopped[t.index]
+	t.timers.stopped[t.index] = true
+	return !stopped
+}
+
+func (f *fakeTimers) afterFunc(_ time.Duration, fn func()) batchTimer {
+	f.funcs = append(f.funcs, fn)
+	f.stopped = append(f.stopped, false)
+	return fakeTimer{timers: f, index: len(f.funcs) - 1}
+}
+
+func (f *fakeTimers) fire(i int) {
+	if !f.stopped[i] {
+		f.stopped[i] = true
+		f.funcs[i]()
+	}
+}
+
+func newTestBatcher() (*joinBatcher, *fakeTimers) {
+	timers := &fakeTimers{}
+	b := newJoinBatcher(discardLogger)
+	b.afterFunc = timers.afterFunc
+	return b, timers
+}
+
+func member(name string) *discordgo.Member {
+	return &discordgo.Member{User: &discordgo.User{Username: name}}
+}
+
+func memberNames(members []*discordgo.Member) []string {
+	names := []string{}
+	for _, m := range members {
+		names = append(names, displayName(m))
+	}
+	return names
+}
+
+func TestJoinBatcherAggregates(t *testing.T) {
+	b, timers := newTestBatcher()
+	flushed := map[string][][]string{}
+	flush := func(channelID string) func([]*discordgo.Member) {
+		return func(members []*discordgo.Member) {
+			flushed[channelID] = append(flushed[channelID], memberNames(members))
+		}
+	}
+
+	b.Add("general", time.Second, member("alice"), flush("general"))
+	b.Add("general", time.Second, member("bob"), flush("general"))
+	b.Add("gaming", time.Second, member("carol"), flush("gaming"))
+	if len(timers.funcs) != 2 {
+		t.Fatalf("opened %d windows, want one per channel", len(timers.funcs))
+	}
+	if len(flushed) != 0 {
+		t.Fatalf("flushed %v before any window closed", flushed)
+	}
+
+	timers.fire(0)
+	b.Add("general", time.Second, member("dave"), flush("general"))
+	timers.fire(1)
+	timers.fire(2)
+
+	want := map[string][][]string{
+		"general": {{"alice", "bob"}, {"dave"}},
+		"gaming":  {{"carol"}},
+	}
+	for channelID, batches := range want {
+		if !slices.EqualFunc(flushed[channelID], batches, slices.Equal[[]string]) {
+			t.Errorf("channel %q flushed %v, want %v", channelID, flushed[channelID], batches)
+		}
+	}
+}
+
+func TestJoinBatcherFlush(t *testing.T) {
+	b, timers := newTestBatcher()
+	var flushed [][]string
+	flush := func(members []*discordgo.Member) {
+		flushed = append(flushed, memberNames(members))
+	}
+
+	b.Add("general", time.Second, member("alice"), flush)
+	b.Flush()
+	if len(flushed) != 1 || !slices.Equal(flushed[0], []string{"alice"}) {
+		t.Fatalf("Flush() flushed %v, want [[alice]]", flushed)
+	}
+	if !timers.stopped[0] {
+		t.Error("Flush() left the window's timer running")
+	}
+
+	//a timer that was already firing when Flush ran must not take the next window's batch
+	b.Add("general", time.Second, member("bob"), flush)
+	timers.funcs[0]()
+	if len(flushed) != 1 {
+		t.Errorf("stale timer flushed %v", flushed[1:])
+	}
+	timers.fire(1)
+	if len(flushed) != 2 || !slices.Equal(flushed[1], []string{"bob"}) {
+		t.Errorf("second window flushed %v, want [bob]", flushed[1:])
+	}
+}
+
+func TestJoinBatcherRecoversFlushPanic(t *testing.T) {
+	b, timers := newTestBatcher()
+	b.Add("general", time.Second, member("alice"), func([]*discordgo.Member) {
+		panic("boom")
+	})
+
+	timers.fire(0)
+	b.Add("general", time.Second, member("bob"), func([]*discordgo.Member) {})
+	if len(timers.funcs) != 2 {
+		t.Error("a panicking flush left its channel stuck open")
+	}
+}
+
+func TestJoinNames(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{names: nil, want: ""},
+		{names: []string{"alice"}, want: "alice"},
+		{names: []string{"alice", "bob"}, want: "alice and bob"},
+		{names: []string{"alice", "bob", "carol"}, want: "alice, bob, and carol"},
+		{names: []string{"alice", "bob", "carol", "dave"}, want: "alice, bob, and 2 others"},
+	}
+	for _, tt := range tests {
+		if got := joinNames(tt.names); got != tt.want {
+			t.Errorf("joinNames(%q) = %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type config struct {
+	NotificationChannelID string
+	EmojiID               string
+	RequiredRoleName      string
+	NotifyCooldownMinutes int
+	NotifyOnLeave         bool
+	NotifyBatchSeconds    int
+	NotificationTemplate  string
+
+	requiredRoleID       string
+	notificationTemplate *template.Template
+}
+
+func (c config) notifyCooldown() time.Duration {
+	if c.NotifyCooldownMinutes <= 0 {
+		return timeout
+	}
+	return time.Duration(c.NotifyCooldownMinutes) * time.Minute
+}
+
+// botConfig holds the per-guild config loaded from disk. Handlers run concurrently so all access goes through the mutex.
+type botConfig struct {
+	mut    sync.RWMutex
+	path   string
+	guilds map[string]config
+}
+
+func newBotConfig(path string) (*botConfig, error) {
+	guilds, err := loadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &botConfig{path: path, guilds: guilds}, nil
+}
+
+func loadConfigFile(path string) (map[string]config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	guilds := map[string]config{}
+	if err := json.Unmarshal(data, &guilds); err != nil {
+		return nil, err
+	}
+	return guilds, nil
+}
+
+func (b *botConfig) Get(guildID string) (config, bool) {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	c, ok := b.guilds[guildID]
+	return c, ok
+}
+
+func (b *botConfig) Set(guildID string, c config) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.guilds[guildID] = c
+}
+
+func (b *botConfig) requiredRoleID(guildID string) string {
+	c, _ := b.Get(guildID)
+	return c.requiredRoleID
+}
+
+// Reload re-reads the config file and resolves it against every guild the bot is in.
+// The old config is kept if anything fails so a bad edit can't take the bot down.
+func (b *botConfig) Reload(s *discordgo.Session, logger *slog.Logger) error {
+	guilds, err := loadConfigFile(b.path)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range s.State.Guilds {
+		guildConfig, err := registerGuild(s, g, guilds[g.ID], logger)
+		if err != nil {
+			return err
+		}
+		guilds[g.ID] = guildConfig
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.guilds = guilds
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// cooldownStore tracks keys that are suppressed until an expiry, like notification cooldowns and mutes. It is saved
+// to disk so a restart doesn't re-notify everyone who just joined.
+type cooldownStore struct {
+	mut     sync.Mutex
+	saveMut sync.Mutex
+	path    string
+	expires map[string]time.Time
+}
+
+// loadCooldownStore reads the store at path, a missing file is an empty store. Expired entries are dropped.
+// A corrupt file is logged and replaced by an empty store, losing cooldowns is better than refusing to start.
+func loadCooldownStore(path string, logger *slog.Logger) (*cooldownStore, error) {
+	c := &cooldownStore{path: path, expires: map[string]time.Time{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.expires); err != nil {
+		logger.Warn("could not parse saved cooldowns, starting empty", slog.String("err", err.Error()), slog.String("path", path))
+		c.expires = map[string]time.Time{}
+		return c, nil
+	}
+
+	c.prune(time.Now())
+	return c, nil
+}
+
+// Start puts key on cooldown for d
+func (c *cooldownStore) Start(key string, d time.Duration) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.expires[key] = time.Now().Add(d)
+}
+
+// Active reports whether key is still on cooldown
+func (c *cooldownStore) Active(key string) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return time.Now().Before(c.expires[key])
+}
+
+// Clear takes key off cooldown early
+func (c *cooldownStore) Clear(key string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	delete(c.expires, key)
+}
+
+// Save writes the unexpired cooldowns to disk. Saves are serialized so an older snapshot can't land after a newer
+// one, and the file is replaced by rename so a crash mid-write can't leave it truncated.
+func (c *cooldownStore) Save() error {
+	c.saveMut.Lock()
+	defer c.saveMut.Unlock()
+
+	c.mut.Lock()
+	c.prune(time.Now())
+	data, err := json.Marshal(c.expires)
+	c.mut.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	//CreateTemp makes the file private, keep the permissions WriteFile used to give it
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// prune must be called with mut held
+func (c *cooldownStore) prune(now time.Time) {
+	for key, expires := range c.expires {
+		if !now.Before(expires) {
+			delete(c.expires, key)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCooldownStoreSaveLoad(t *testing.T) {
+	//the same store backs cooldowns and mutes, so this covers both files
+	path := filepath.Join(t.TempDir(), "cooldowns.json")
+	c, err := loadCooldownStore(path, discardLogger)
+	if err != nil {
+		t.Fatalf("loadCooldownStore() missing file error = %v", err)
+	}
+	c.Start("active", time.Hour)
+	c.Start("cleared", time.Hour)
+	c.Start("expired", -time.Minute)
+	c.Clear("cleared")
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := loadCooldownStore(path, discardLogger)
+	if err != nil {
+		t.Fatalf("loadCooldownStore() error = %v", err)
+	}
+	for key, want := range map[string]bool{"active": true, "cleared": false, "expired": false} {
+		if got := loaded.Active(key); got != want {
+			t.Errorf("Active(%q) = %v, want %v", key, got, want)
+		}
+	}
+	if len(loaded.expires) != 1 {
+		t.Errorf("loaded %d entries, want only the active one: %v", len(loaded.expires), loaded.expires)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Save() left %d files behind, want just the store", len(entries))
+	}
+}
+
+func TestCooldownStoreCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mutes.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadCooldownStore(path, discardLogger)
+	if err != nil {
+		t.Fatalf("loadCooldownStore() error = %v, want an empty store", err)
+	}
+	if len(c.expires) != 0 {
+		t.Errorf("loadCooldownStore() = %v, want an empty store", c.expires)
+	}
+
+	c.Start("key", time.Hour)
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if loaded, err := loadCooldownStore(path, discardLogger); err != nil || !loaded.Active("key") {
+		t.Errorf("corrupt file was not replaced on save, err = %v", err)
+	}
+}
+
+func TestCooldownStoreConcurrentSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cooldowns.json")
+	c, err := loadCooldownStore(path, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Start(string(rune('a'+i)), time.Hour)
+			if err := c.Save(); err != nil {
+				t.Errorf("Save() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	loaded, err := loadCooldownStore(path, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.expires) != 20 {
+		t.Errorf("loaded %d entries after concurrent saves, want 20", len(loaded.expires))
+	}
+}
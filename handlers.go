@@ -0,0 +1,47 @@
+package main
+
+import "sync"
+
+// handlerAdder registers an event handler and returns the func that unregisters it
+type handlerAdder interface {
+	AddHandler(handler interface{}) func()
+}
+
+// handlerSet holds the bot's event handlers apart from any session so they can be registered more than once
+// without stacking. Registering again removes the previous registration first.
+type handlerSet struct {
+	mut      sync.Mutex
+	handlers []interface{}
+	remove   []func()
+}
+
+// Add queues handler for the next Register
+func (h *handlerSet) Add(handler interface{}) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.handlers = append(h.handlers, handler)
+}
+
+// Register adds every handler to s, replacing whatever an earlier Register added
+func (h *handlerSet) Register(s handlerAdder) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.removeLocked()
+	for _, handler := range h.handlers {
+		h.remove = append(h.remove, s.AddHandler(handler))
+	}
+}
+
+// Remove takes every registered handler back off its session
+func (h *handlerSet) Remove() {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.removeLocked()
+}
+
+func (h *handlerSet) removeLocked() {
+	for _, remove := range h.remove {
+		remove()
+	}
+	h.remove = nil
+}
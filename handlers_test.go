@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+// fakeAdder keeps handlers by registration so emit reaches only the ones that haven't been removed
+type fakeAdder struct {
+	next     int
+	handlers map[int]func()
+}
+
+func (f *fakeAdder) AddHandler(handler interface{}) func() {
+	id := f.next
+	f.next++
+	f.handlers[id] = handler.(func())
+	return func() { delete(f.handlers, id) }
+}
+
+func (f *fakeAdder) emit() {
+	for _, h := range f.handlers {
+		h()
+	}
+}
+
+func TestHandlerSetRegisterTwice(t *testing.T) {
+	s := &fakeAdder{handlers: map[int]func(){}}
+	calls := 0
+	h := &handlerSet{}
+	h.Add(func() { calls++ })
+
+	h.Register(s)
+	h.Register(s)
+	s.emit()
+	if calls != 1 {
+		t.Errorf("handler called %d times per event, want 1", calls)
+	}
+
+	h.Remove()
+	s.emit()
+	if calls != 1 {
+		t.Errorf("handler called after Remove, got %d calls, want 1", calls)
+	}
+}
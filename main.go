@@ -2,183 +2,368 @@ package main
 
 import (
 	"context"
-	_ "embed"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"runtime/debug"
 	"slices"
 	"strings"
-	"sync"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-//go:embed config.json
-var configFile []byte
-var timeoutCorner sync.Map
+// timeout is the notification cooldown used when a guild does not configure one
 const timeout = 5 * time.Minute
 
+var (
+	tokenFlag      = flag.String("token", "", "discord bot token, prefer setting DISCORD_BOT_TOKEN instead")
+	configPath     = flag.String("config", "config.json", "path to the guild config file")
+	cooldownsPath  = flag.String("cooldowns", "cooldowns.json", "path to the file notification cooldowns are saved in")
+	mutesPath      = flag.String("mutes", "mutes.json", "path to the file notification mutes are saved in")
+	cleanCommands  = flag.Bool("clean-commands", false, "delete the bot's slash commands on shutdown")
+	globalCommands = flag.Bool("global-commands", false, "register slash commands globally instead of per guild, changes can take an hour to show up")
+	logLevel       = flag.String("log-level", "", "debug, info, warn or error, defaults to LOG_LEVEL or info")
+	logFormat      = flag.String("log-format", "json", "json, or text for local development")
+)
+
 func main() {
-	if err := run(context.Background()); err != nil {
+	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if err := run(ctx); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
-type config struct {
-	NotificationChannelID string
-	EmojiID               string
-	RequiredRoleName      string
-
-	requiredRoleID string
-}
-
-type slashCommand struct {
-	Description string
-	Handler     func(s *discordgo.Session, i *discordgo.InteractionCreate)
-}
-
-type slashCommands map[string]slashCommand
-
-func run(_ context.Context) error {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		AddSource:   true,
-		Level:       slog.LevelDebug,
-		ReplaceAttr: nil,
-	}))
+// run starts the bot and blocks until ctx is cancelled
+func run(ctx context.Context) error {
+	logger, err := newLogger(*logLevel, *logFormat)
+	if err != nil {
+		return err
+	}
 	//load config
-	m := map[string]config{}
-	err := json.Unmarshal(configFile, &m)
+	cfg, err := newBotConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	cooldowns, err := loadCooldownStore(*cooldownsPath, logger)
+	if err != nil {
+		return err
+	}
+	mutes, err := loadCooldownStore(*mutesPath, logger)
 	if err != nil {
 		return err
 	}
 
-	//start a bot. args[1] should be the token for the bot.
+	//start a bot. see resolveToken for where the token comes from.
 	//bot needs permission to see presence, see users, manage roles, see voice activity, and send messages
 	//https://discord.com/api/oauth2/authorize?client_id=408164522067755008&permissions=139888692224&scope=bot
-	session, err := discordgo.New("Bot " + os.Args[1])
+	token, err := resolveToken()
+	if err != nil {
+		return err
+	}
+	session, err := discordgo.New("Bot " + token)
 	if err != nil {
 		return err
 	}
 
-	//Add presence updates
+	stats := &metrics{}
+	joins := newJoinBatcher(logger)
+
+	//handlers are collected and registered on the session in one place, see handlerSet
+	handlers := &handlerSet{}
+	defer handlers.Remove()
+
+	//Add presence updates. discordgo's state cache tracks them for shouldNotify, so no handler is needed
 	session.Identify.Intents = discordgo.IntentsAllWithoutPrivileged | discordgo.IntentGuildPresences
-	session.AddHandler(func(s *discordgo.Session, m *discordgo.PresenceUpdate) {
-		logger.Debug("presence update", slog.String("user", m.User.ID), slog.String("status", string(m.Status)))
-	})
 
 	//TODO refactor the handlers to be factory functions that take in the config/logger/etc and return the function
 	commands := slashCommands{
 		"voice-spam": {
 			Description: "opts the user in to the voice-spam role",
+			Group:       groupVoice,
+			Handler:     optInHandler(session, cfg, stats, logger),
+		},
+		"no-spam": {
+			Description: "opts the user out of the voice-spam role",
+			Group:       groupVoice,
+			Handler:     optOutHandler(session, cfg, stats, logger),
+		},
+		"mute-notifications": {
+			Description: "stops announcing you in voice for a while without leaving the role",
+			Group:       groupVoice,
+			Options:     muteOptions,
+			Handler:     muteHandler(session, mutes, logger),
+		},
+		"unmute-notifications": {
+			Description: "announces you in voice again",
+			Group:       groupVoice,
+			Handler:     unmuteHandler(session, mutes, logger),
+		},
+		"bot-perms": {
+			Description: "shows the bot's permissions in this channel",
+			Group:       groupAdmin,
 			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-				if err := s.GuildMemberRoleAdd(i.GuildID, i.Member.User.ID, m[i.GuildID].requiredRoleID); err != nil {
-					logger.Error("could not add role to user", slog.String("err", err.Error()), slog.String("guild", i.GuildID), slog.String("user", i.Member.User.Username))
+				//discord sends the bot's permissions in the channel with the interaction, the state cache is only a fallback
+				perms := i.AppPermissions
+				if perms == 0 {
+					var err error
+					perms, err = s.UserChannelPermissions(s.State.User.ID, i.ChannelID)
+					if err != nil {
+						logger.Error("could not resolve bot permissions", slog.String("err", err.Error()), slog.String("guild", i.GuildID), slog.String("channel", i.ChannelID))
+						respondEphemeral(s, i, "Could not work out my permissions in this channel")
+						return
+					}
+				}
+
+				respondEphemeral(s, i, buildPermissionsMessage(perms))
+			},
+		},
+		"post-role-menu": {
+			Description: "posts a message with buttons to toggle roles",
+			Group:       groupVoice,
+			Permissions: discordgo.PermissionManageRoles,
+			Handler:     postRoleMenuHandler(session, cfg, logger),
+		},
+		"stats": {
+			Description: "shows what the bot has done in this server since it started",
+			Group:       groupAdmin,
+			Permissions: discordgo.PermissionManageServer,
+			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+				if i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+					respondEphemeral(s, i, "Only server managers may view stats")
 					return
 				}
 
-				s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseChannelMessageWithSource,
-					Data: &discordgo.InteractionResponseData{
-						Content: "Thou hast been granted \"hello-there\"",
-						Flags: discordgo.MessageFlagsEphemeral,
-					},
-				})
+				respondEphemeral(s, i, stats.Guild(i.GuildID).String())
 			},
 		},
-		"no-spam": {
-			Description: "opts the user out of the voice-spam role",
+		"reload-config": {
+			Description: "reloads the config file for every server, nothing changes if any server's config is invalid",
+			Group:       groupAdmin,
+			Permissions: discordgo.PermissionManageServer,
 			Handler: func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-				if err := s.GuildMemberRoleRemove(i.GuildID, i.Member.User.ID, m[i.GuildID].requiredRoleID); err != nil {
-					logger.Error("could not add role to user", slog.String("err", err.Error()), slog.String("guild", i.GuildID), slog.String("user", i.Member.User.Username))
+				if i.Member.Permissions&discordgo.PermissionManageServer == 0 {
+					respondEphemeral(s, i, "Only server managers may reload the config")
 					return
 				}
 
-				s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseChannelMessageWithSource,
-					Data: &discordgo.InteractionResponseData{
-						Content: "Thou hast had thy privileges revoked",
-						Flags: discordgo.MessageFlagsEphemeral,
-					},
-				})
+				if err := cfg.Reload(s, logger); err != nil {
+					logger.Error("could not reload config", slog.String("err", err.Error()), slog.String("guild", i.GuildID))
+					respondEphemeral(s, i, "Could not reload config, keeping the old one: "+err.Error())
+					return
+				}
+
+				logger.Info("reloaded config", slog.String("guild", i.GuildID), slog.String("user", interactionUser(i).Username))
+				respondEphemeral(s, i, "Config reloaded")
 			},
 		},
 	}
 
-	session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		if h, ok := commands[i.ApplicationCommandData().Name]; ok {
-			h.Handler(s, i)
+	commands["help"] = slashCommand{
+		Description: "lists the bot's commands",
+		Group:       groupAdmin,
+		Handler:     helpHandler(commands),
+	}
+
+	toggleRole := roleButtonHandler(session, cfg, stats, logger)
+	handlers.Add(safeHandler(logger, func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		//DMs have no member, and every command here needs a guild to act on
+		if i.Member == nil {
+			respondEphemeral(s, i, "hello-there only works inside a server")
+			return
+		}
+
+		switch i.Type {
+		case discordgo.InteractionApplicationCommand:
+			if h, ok := commands[i.ApplicationCommandData().Name]; ok {
+				h.Handler(s, i)
+			}
+		case discordgo.InteractionMessageComponent:
+			if strings.HasPrefix(i.MessageComponentData().CustomID, roleButtonPrefix) {
+				toggleRole(s, i)
+			}
 		}
-	})
+	}))
 
 	//handle the ready event to prepare config object with guild specific info
-	session.AddHandler(func(s *discordgo.Session, vs *discordgo.Ready) {
+	//the first result is reported on ready so a bad config stops startup instead of failing per-user later
+	//discordgo sends Ready again whenever it has to start a fresh gateway session (a plain resume sends Resumed and keeps
+	//the state cache), so everything here must be safe to repeat: configs are overwritten in place, command
+	//registration is a bulk overwrite, and later results are dropped rather than blocking on ready
+	ready := make(chan error, 1)
+	handlers.Add(safeHandler(logger, func(s *discordgo.Session, vs *discordgo.Ready) {
 		logger.Debug("ready")
-		for _, g := range vs.Guilds {
-			guildConfig, err := registerGuild(s, g, m[g.ID])
-			if err != nil {
-				logger.Error("error registering guild", slog.String("err", err.Error()))
-				return
+		var readyErr error
+		defer func() {
+			select {
+			case ready <- readyErr:
+			default:
 			}
+		}()
 
-			//Register interactions
-			for name, cmd := range commands {
-				_, err := session.ApplicationCommandCreate(session.State.User.ID, g.ID, &discordgo.ApplicationCommand{Name: name, Description: cmd.Description})
-				if err != nil {
-					logger.Error("could not register command", slog.String("err", err.Error()))
-				}
-			}
+		//Register interactions
+		if err := commands.SyncCommands(s, applicationID(s), guildIDs(vs.Guilds), *globalCommands); err != nil {
+			logger.Error("could not register commands", slog.String("err", err.Error()))
+		}
 
-			m[g.ID] = guildConfig
+		if err := registerGuilds(s, cfg, vs.Guilds, logger); err != nil {
+			logger.Error("error registering guild", slog.String("err", err.Error()))
+			readyErr = err
 		}
-	})
+	}))
 
-	session.AddHandler(func(s *discordgo.Session, vs *discordgo.VoiceStateUpdate) {
-		logger = logger.With(slog.String("username", vs.Member.User.Username), slog.String("guild", vs.GuildID), slog.String("channel", vs.ChannelID))
+	handlers.Add(safeHandler(logger, func(s *discordgo.Session, vs *discordgo.VoiceStateUpdate) {
+		logger := logger.With(slog.String("username", vs.Member.User.Username), slog.String("guild", vs.GuildID), slog.String("channel", vs.ChannelID))
 
-		logger.Info("joined")
-		c, ok := m[vs.GuildID]
+		c, ok := cfg.Get(vs.GuildID)
 		if !ok {
 			logger.Warn("unknown guild")
 			return
 		}
 
-		if !shouldNotify(s, vs, logger, c) {
+		if isLeave(vs) {
+			logger.Info("left")
+			if !c.NotifyOnLeave || !shouldNotifyLeave(vs, logger, c, cooldowns, mutes, time.Now()) {
+				return
+			}
+
+			message, err := buildLeaveMessage(vs, session.Channel)
+			if err != nil {
+				logger.Error("could not build leave message", slog.String("err", err.Error()))
+				return
+			}
+			if _, err := session.ChannelMessageSend(c.NotificationChannelID, message); err != nil {
+				logger.Error("could not sent message", slog.String("err", err.Error()))
+				return
+			}
+			stats.Guild(vs.GuildID).LeaveNotifications.Add(1)
+
+			cooldowns.Start(leaveCooldownKey(vs.GuildID, vs.UserID), c.notifyCooldown())
+			if err := cooldowns.Save(); err != nil {
+				logger.Error("could not save cooldowns", slog.String("err", err.Error()))
+			}
 			return
 		}
 
-		message, err := buildNotificationMessage(c, vs, session)
-		if err != nil {
-			logger.Error("could not build message", slog.String("err", err.Error()))
+		logger.Info("joined")
+		if !shouldNotify(s, vs, logger, c, cooldowns, mutes, time.Now()) {
 			return
 		}
-		if _, err := session.ChannelMessageSend(c.NotificationChannelID, message); err != nil {
-			logger.Error("could not sent message", slog.String("err", err.Error()))
-			return
+
+		if c.NotifyBatchSeconds > 0 {
+			joins.Add(vs.ChannelID, time.Duration(c.NotifyBatchSeconds)*time.Second, vs.Member, func(members []*discordgo.Member) {
+				message, err := buildBatchNotificationMessage(c, members, vs.ChannelID, session.Channel, logger)
+				if err != nil {
+					logger.Error("could not build message", slog.String("err", err.Error()))
+					return
+				}
+				if _, err := session.ChannelMessageSend(c.NotificationChannelID, message); err != nil {
+					logger.Error("could not sent message", slog.String("err", err.Error()))
+					return
+				}
+				stats.Guild(vs.GuildID).JoinNotifications.Add(int64(len(members)))
+			})
+		} else {
+			message, err := buildNotificationMessage(c, vs, session.Channel, logger)
+			if err != nil {
+				logger.Error("could not build message", slog.String("err", err.Error()))
+				return
+			}
+			if _, err := session.ChannelMessageSend(c.NotificationChannelID, message); err != nil {
+				logger.Error("could not sent message", slog.String("err", err.Error()))
+				return
+			}
+			stats.Guild(vs.GuildID).JoinNotifications.Add(1)
 		}
 
-		timeoutCorner.Store(vs.UserID, true)
-		time.AfterFunc(timeout, func() { timeoutCorner.Delete(vs.UserID) })
-	})
+		cooldowns.Start(cooldownKey(vs.GuildID, vs.UserID), c.notifyCooldown())
+		if err := cooldowns.Save(); err != nil {
+			logger.Error("could not save cooldowns", slog.String("err", err.Error()))
+		}
+	}))
 
+	handlers.Register(session)
 	err = session.Open()
 	if err != nil {
 		return err
 	}
+	select {
+	case err := <-ready:
+		if err != nil {
+			session.Close()
+			return err
+		}
+	case <-ctx.Done():
+		return session.Close()
+	}
 
 	fmt.Println("hello-there is now running.  Press CTRL-C to exit.")
-	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-sc
+	<-ctx.Done()
+	//stop taking events first so no join can open a window after the flush
+	handlers.Remove()
+	joins.Flush()
+
+	if *cleanCommands {
+		if err := (slashCommands{}).SyncCommands(session, applicationID(session), guildIDs(session.State.Guilds), false); err != nil {
+			logger.Error("could not delete commands", slog.String("err", err.Error()))
+		}
+	}
 	// Cleanly close down the Discord session.
 	return session.Close()
 }
 
-func shouldNotify(s *discordgo.Session, vs *discordgo.VoiceStateUpdate, logger *slog.Logger, c config) bool {
+// newLogger builds the package logger, the level falls back to LOG_LEVEL and then info when not given
+func newLogger(level, format string) (*slog.Logger, error) {
+	if level == "" {
+		level = os.Getenv("LOG_LEVEL")
+	}
+	if level == "" {
+		level = "info"
+	}
+
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     l,
+	}
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stdout, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stdout, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// resolveToken looks for the bot token in DISCORD_BOT_TOKEN, then the -token flag, then the first positional argument.
+// The positional argument is only kept for backwards compatibility since it leaks the token into shell history.
+func resolveToken() (string, error) {
+	if token := os.Getenv("DISCORD_BOT_TOKEN"); token != "" {
+		return token, nil
+	}
+	if *tokenFlag != "" {
+		return *tokenFlag, nil
+	}
+	if token := flag.Arg(0); token != "" {
+		return token, nil
+	}
+	return "", errors.New("no bot token provided, set DISCORD_BOT_TOKEN or pass -token")
+}
+
+func shouldNotify(s *discordgo.Session, vs *discordgo.VoiceStateUpdate, logger *slog.Logger, c config, cooldowns, mutes *cooldownStore, now time.Time) bool {
 	//check if the user is just joining voice. This prevents mute/change channel/etc from triggering the notification
 	if vs.BeforeUpdate != nil {
 		logger.Debug("user already in a voice channel")
@@ -186,10 +371,9 @@ func shouldNotify(s *discordgo.Session, vs *discordgo.VoiceStateUpdate, logger *
 	}
 
 	//check quiet hours
-	current := time.Now().Hour();
-	if current < 8 || current > 22 {
+	if isQuietHours(now) {
 		logger.Debug("quiet hours in effect")
-		return false;
+		return false
 	}
 
 	//check the users presence
@@ -210,8 +394,12 @@ func shouldNotify(s *discordgo.Session, vs *discordgo.VoiceStateUpdate, logger *
 		return false
 	}
 
-	_, ok := timeoutCorner.Load(vs.UserID)
-	if ok {
+	if mutes.Active(cooldownKey(vs.GuildID, vs.UserID)) {
+		logger.Debug("user muted notifications")
+		return false
+	}
+
+	if cooldowns.Active(cooldownKey(vs.GuildID, vs.UserID)) {
 		logger.Debug("user already joined recently")
 		return false
 	}
@@ -219,39 +407,279 @@ func shouldNotify(s *discordgo.Session, vs *discordgo.VoiceStateUpdate, logger *
 	return true
 }
 
-func buildNotificationMessage(c config, vs *discordgo.VoiceStateUpdate, session *discordgo.Session) (string, error) {
+// isLeave reports whether the update is the user disconnecting from voice. Only a disconnect clears the channel,
+// mute/deafen and channel moves keep one set.
+func isLeave(vs *discordgo.VoiceStateUpdate) bool {
+	return vs.ChannelID == "" && vs.BeforeUpdate != nil
+}
+
+// shouldNotifyLeave skips the presence check since a user leaving voice has often just gone offline. Leaves have their
+// own cooldown so hopping in and out of voice can't spam the channel, without a join suppressing the next leave.
+func shouldNotifyLeave(vs *discordgo.VoiceStateUpdate, logger *slog.Logger, c config, cooldowns, mutes *cooldownStore, now time.Time) bool {
+	if isQuietHours(now) {
+		logger.Debug("quiet hours in effect")
+		return false
+	}
+
+	if !userHasRole(vs.Member.Roles, c.requiredRoleID) {
+		logger.Debug("user does not have role")
+		return false
+	}
+
+	if mutes.Active(cooldownKey(vs.GuildID, vs.UserID)) {
+		logger.Debug("user muted notifications")
+		return false
+	}
+
+	if cooldowns.Active(leaveCooldownKey(vs.GuildID, vs.UserID)) {
+		logger.Debug("user already left recently")
+		return false
+	}
+
+	return true
+}
+
+func isQuietHours(now time.Time) bool {
+	current := now.Hour()
+	return current < 8 || current > 22
+}
+
+// notificationTemplateData is what a guild's NotificationTemplate (a text/template) can reference.
+// Nick falls back to the username so templates don't need to handle members without one. Batched joins render the
+// same template once for everyone in the batch: Nick and Username list them in prose and Names holds each nick.
+type notificationTemplateData struct {
+	Emoji       string
+	Nick        string
+	Username    string
+	ChannelName string
+	Names       []string
+}
+
+// channelLookup resolves a channel ID to the channel, as session.Channel does
+type channelLookup func(channelID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+
+func buildNotificationMessage(c config, vs *discordgo.VoiceStateUpdate, channels channelLookup, logger *slog.Logger) (string, error) {
+	channel, err := channels(vs.ChannelID)
+	if err != nil {
+		return "", err
+	}
+
+	return renderNotification(c, []*discordgo.Member{vs.Member}, channel, logger), nil
+}
+
+// renderNotification announces members joining channel with the guild's template, or the default message when the
+// guild has none or it fails to render
+func renderNotification(c config, members []*discordgo.Member, channel *discordgo.Channel, logger *slog.Logger) string {
+	names := make([]string, 0, len(members))
+	usernames := make([]string, 0, len(members))
+	for _, m := range members {
+		names = append(names, displayName(m))
+		usernames = append(usernames, m.User.Username)
+	}
+
 	b := strings.Builder{}
+	if c.notificationTemplate != nil {
+		err := c.notificationTemplate.Execute(&b, notificationTemplateData{
+			Emoji:       c.EmojiID,
+			Nick:        joinNames(names),
+			Username:    joinNames(usernames),
+			ChannelName: channelName(channel),
+			Names:       names,
+		})
+		if err == nil {
+			return b.String()
+		}
+		logger.Warn("could not render notification template, using the default message", slog.String("err", err.Error()))
+		b.Reset()
+	}
 
 	b.WriteString(c.EmojiID + " looks like ")
-	if vs.Member.Nick != "" {
-		b.WriteString(vs.Member.Nick)
-	} else {
-		b.WriteString(vs.Member.User.Username)
-	}
+	b.WriteString(joinNames(names))
 	b.WriteString(" just joined ")
+	b.WriteString(channelName(channel))
+	return b.String()
+}
+
+func buildLeaveMessage(vs *discordgo.VoiceStateUpdate, channels channelLookup) (string, error) {
+	b := strings.Builder{}
 
-	channel, err := session.Channel(vs.ChannelID)
+	b.WriteString(displayName(vs.Member))
+	b.WriteString(" just left ")
+
+	channel, err := channels(vs.BeforeUpdate.ChannelID)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 
-	b.WriteString(channel.Name)
+	b.WriteString(channelName(channel))
 	return b.String(), nil
 }
 
-func registerGuild(s *discordgo.Session, g *discordgo.Guild, guildConfig config) (config, error) {
+func displayName(m *discordgo.Member) string {
+	if m.Nick != "" {
+		return m.Nick
+	}
+	return m.User.Username
+}
+
+// channelName falls back to the ID so a channel without a resolvable name doesn't produce a dangling message
+func channelName(channel *discordgo.Channel) string {
+	if channel.Name == "" {
+		return channel.ID
+	}
+	return channel.Name
+}
+
+// guildFetcher looks up a guild with its current roles
+type guildFetcher interface {
+	Guild(guildID string, options ...discordgo.RequestOption) (*discordgo.Guild, error)
+}
+
+func registerGuild(s guildFetcher, g *discordgo.Guild, guildConfig config, logger *slog.Logger) (config, error) {
 	guild, err := s.Guild(g.ID)
 	if err != nil {
 		return config{}, err
 	}
+	//resolve from scratch so a renamed or deleted role isn't hidden by the ID from an earlier ready
+	guildConfig.requiredRoleID = ""
 	for _, role := range guild.Roles {
 		if role.Name == guildConfig.RequiredRoleName {
 			guildConfig.requiredRoleID = role.ID
 		}
 	}
+	//guilds without config have no role to resolve, but a configured role that doesn't exist would break every opt-in
+	if guildConfig.RequiredRoleName != "" && guildConfig.requiredRoleID == "" {
+		return config{}, fmt.Errorf("guild %s (%s) has no role named %q", guild.Name, guild.ID, guildConfig.RequiredRoleName)
+	}
+
+	guildConfig.notificationTemplate = nil
+	if guildConfig.NotificationTemplate != "" {
+		//a bad template only costs the guild its custom phrasing, so keep the default message rather than failing
+		tmpl, err := template.New(guild.ID).Parse(guildConfig.NotificationTemplate)
+		if err != nil {
+			logger.Warn("invalid notification template, using the default message", slog.String("err", err.Error()), slog.String("guild", guild.ID))
+		} else {
+			guildConfig.notificationTemplate = tmpl
+		}
+	}
 	return guildConfig, nil
 }
 
+// registerGuilds resolves the config for every guild, keeping going past failures so one broken guild
+// doesn't leave the rest unregistered. The failures are joined into the returned error.
+func registerGuilds(s guildFetcher, cfg *botConfig, guilds []*discordgo.Guild, logger *slog.Logger) error {
+	var errs []error
+	for _, g := range guilds {
+		c, _ := cfg.Get(g.ID)
+		guildConfig, err := registerGuild(s, g, c, logger)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		cfg.Set(g.ID, guildConfig)
+	}
+	return errors.Join(errs...)
+}
+
+// cooldownKey scopes the notification cooldown to a single guild so joins in one server don't suppress another
+func cooldownKey(guildID, userID string) string {
+	return guildID + ":" + userID
+}
+
+// leaveCooldownKey keeps leave cooldowns apart from join cooldowns in the shared store
+func leaveCooldownKey(guildID, userID string) string {
+	return cooldownKey(guildID, userID) + ":leave"
+}
+
+// safeHandler recovers panics from an event handler so one bad event is logged instead of taking down the bot
+func safeHandler[T any](logger *slog.Logger, h func(s *discordgo.Session, event T)) func(s *discordgo.Session, event T) {
+	return func(s *discordgo.Session, event T) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("recovered from handler panic", slog.String("event", fmt.Sprintf("%T", event)), slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
+			}
+		}()
+		h(s, event)
+	}
+}
+
+// interactionUser returns the acting user, which discord puts on Member in guilds and on User in DMs.
+// The dispatcher currently turns away interactions without a Member, so the User fallback only matters for callers
+// outside it, but it keeps the helper safe to use anywhere.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+func interactionUserID(i *discordgo.InteractionCreate) string {
+	return interactionUser(i).ID
+}
+
+// interactionResponder answers interactions
+type interactionResponder interface {
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+}
+
+func respondEphemeral(s interactionResponder, i *discordgo.InteractionCreate, content string) {
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+func guildIDs(guilds []*discordgo.Guild) []string {
+	ids := make([]string, 0, len(guilds))
+	for _, g := range guilds {
+		ids = append(ids, g.ID)
+	}
+	return ids
+}
+
 func userHasRole(userRoleIDs []string, serverRoleID string) bool {
 	return slices.Contains(userRoleIDs, serverRoleID)
 }
+
+type botPermission struct {
+	Name       string
+	Permission int64
+	//Required is set for permissions an existing feature depends on
+	Required bool
+}
+
+var botPermissions = []botPermission{
+	{Name: "Send Messages", Permission: discordgo.PermissionSendMessages, Required: true},
+	{Name: "Embed Links", Permission: discordgo.PermissionEmbedLinks},
+	{Name: "Manage Roles", Permission: discordgo.PermissionManageRoles, Required: true},
+	{Name: "Connect", Permission: discordgo.PermissionVoiceConnect},
+	{Name: "Speak", Permission: discordgo.PermissionVoiceSpeak},
+	{Name: "Add Reactions", Permission: discordgo.PermissionAddReactions},
+}
+
+func buildPermissionsMessage(perms int64) string {
+	b := strings.Builder{}
+	missing := 0
+
+	b.WriteString("Permissions in this channel:\n")
+	for _, p := range botPermissions {
+		switch {
+		case perms&p.Permission == p.Permission:
+			b.WriteString("✅ " + p.Name + "\n")
+		case p.Required:
+			missing++
+			b.WriteString("❌ **" + p.Name + "** (required)\n")
+		default:
+			b.WriteString("➖ " + p.Name + "\n")
+		}
+	}
+
+	if missing > 0 {
+		b.WriteString(fmt.Sprintf("%d required permission(s) missing, some features will not work", missing))
+	}
+	return b.String()
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestResolveToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		flag    string
+		want    string
+		wantErr bool
+	}{
+		{name: "env", env: "env-token", flag: "flag-token", want: "env-token"},
+		{name: "flag", flag: "flag-token", want: "flag-token"},
+		{name: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DISCORD_BOT_TOKEN", tt.env)
+			old := *tokenFlag
+			*tokenFlag = tt.flag
+			t.Cleanup(func() { *tokenFlag = old })
+
+			got, err := resolveToken()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		level     string
+		envLevel  string
+		format    string
+		wantLevel slog.Level
+		wantErr   bool
+	}{
+		{name: "default level", format: "json", wantLevel: slog.LevelInfo},
+		{name: "flag level", level: "debug", envLevel: "error", format: "json", wantLevel: slog.LevelDebug},
+		{name: "env level", envLevel: "warn", format: "text", wantLevel: slog.LevelWarn},
+		{name: "unknown level", level: "loud", format: "json", wantErr: true},
+		{name: "unknown format", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOG_LEVEL", tt.envLevel)
+
+			logger, err := newLogger(tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newLogger() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !logger.Enabled(context.Background(), tt.wantLevel) || logger.Enabled(context.Background(), tt.wantLevel-1) {
+				t.Errorf("newLogger() is not enabled at exactly %s", tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestSafeHandlerRecoversPanic(t *testing.T) {
+	h := safeHandler(discardLogger, func(s *discordgo.Session, event *discordgo.Ready) {
+		panic("boom")
+	})
+
+	//a panic escaping safeHandler fails the test run
+	h(nil, &discordgo.Ready{})
+}
+
+func TestInteractionUserID(t *testing.T) {
+	tests := []struct {
+		name string
+		i    *discordgo.InteractionCreate
+		want string
+	}{
+		{
+			name: "guild member",
+			i:    &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{Member: &discordgo.Member{User: &discordgo.User{ID: "member"}}}},
+			want: "member",
+		},
+		{
+			name: "dm user",
+			i:    &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{User: &discordgo.User{ID: "user"}}},
+			want: "user",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interactionUserID(tt.i); got != tt.want {
+				t.Errorf("interactionUserID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeGuilds serves guilds from memory in place of the discord API
+type fakeGuilds struct {
+	guilds map[string]*discordgo.Guild
+	calls  int
+}
+
+func (f *fakeGuilds) Guild(guildID string, _ ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	f.calls++
+	g, ok := f.guilds[guildID]
+	if !ok {
+		return nil, errors.New("unknown guild " + guildID)
+	}
+	return g, nil
+}
+
+func TestRegisterGuild(t *testing.T) {
+	guilds := &fakeGuilds{guilds: map[string]*discordgo.Guild{
+		"1": {ID: "1", Name: "server", Roles: []*discordgo.Role{{ID: "10", Name: "hello-there"}}},
+	}}
+	tests := []struct {
+		name       string
+		guildID    string
+		config     config
+		wantRoleID string
+		wantErr    bool
+	}{
+		{name: "resolves the role", guildID: "1", config: config{RequiredRoleName: "hello-there"}, wantRoleID: "10"},
+		{name: "no role configured", guildID: "1", config: config{}},
+		{name: "missing role", guildID: "1", config: config{RequiredRoleName: "voice-spam"}, wantErr: true},
+		{name: "stale role id is cleared", guildID: "1", config: config{RequiredRoleName: "voice-spam", requiredRoleID: "10"}, wantErr: true},
+		{name: "unknown guild", guildID: "2", config: config{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registerGuild(guilds, &discordgo.Guild{ID: tt.guildID}, tt.config, discardLogger)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("registerGuild() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.requiredRoleID != tt.wantRoleID {
+				t.Errorf("registerGuild() requiredRoleID = %q, want %q", got.requiredRoleID, tt.wantRoleID)
+			}
+		})
+	}
+}
+
+func TestRegisterGuildsRepeatedReady(t *testing.T) {
+	guilds := &fakeGuilds{guilds: map[string]*discordgo.Guild{
+		"1": {ID: "1", Name: "good", Roles: []*discordgo.Role{{ID: "10", Name: "hello-there"}}},
+		"2": {ID: "2", Name: "broken"},
+		"3": {ID: "3", Name: "also good", Roles: []*discordgo.Role{{ID: "30", Name: "hello-there"}}},
+	}}
+	cfg := &botConfig{guilds: map[string]config{
+		"1": {RequiredRoleName: "hello-there"},
+		"2": {RequiredRoleName: "hello-there"},
+		"3": {RequiredRoleName: "hello-there"},
+	}}
+	ready := []*discordgo.Guild{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+
+	if err := registerGuilds(guilds, cfg, ready, discardLogger); err == nil {
+		t.Fatal("registerGuilds() error = nil, want the broken guild reported")
+	}
+	first := map[string]config{}
+	for id, c := range cfg.guilds {
+		first[id] = c
+	}
+	if first["3"].requiredRoleID != "30" {
+		t.Errorf("guild after the broken one has requiredRoleID %q, want %q", first["3"].requiredRoleID, "30")
+	}
+
+	//a second ready must resolve every guild again and land on the same config
+	if err := registerGuilds(guilds, cfg, ready, discardLogger); err == nil {
+		t.Fatal("second registerGuilds() error = nil, want the broken guild reported")
+	}
+	if guilds.calls != 2*len(ready) {
+		t.Errorf("Guild called %d times, want %d", guilds.calls, 2*len(ready))
+	}
+	if !reflect.DeepEqual(cfg.guilds, first) {
+		t.Errorf("config after second ready = %+v, want %+v", cfg.guilds, first)
+	}
+}
+
+func stubChannels(channel *discordgo.Channel, err error) channelLookup {
+	return func(string, ...discordgo.RequestOption) (*discordgo.Channel, error) {
+		return channel, err
+	}
+}
+
+func TestBuildMessagesChannelLookup(t *testing.T) {
+	member := &discordgo.Member{Nick: "nick", User: &discordgo.User{ID: "1", Username: "user"}}
+	join := &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{ChannelID: "20", Member: member}}
+	leave := &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{Member: member}, BeforeUpdate: &discordgo.VoiceState{ChannelID: "20"}}
+	c := config{EmojiID: ":wave:"}
+	build := map[string]func(channelLookup) (string, error){
+		"join": func(channels channelLookup) (string, error) {
+			return buildNotificationMessage(c, join, channels, discardLogger)
+		},
+		"leave": func(channels channelLookup) (string, error) {
+			return buildLeaveMessage(leave, channels)
+		},
+		"batch": func(channels channelLookup) (string, error) {
+			return buildBatchNotificationMessage(c, []*discordgo.Member{member}, "20", channels, discardLogger)
+		},
+	}
+	tests := []struct {
+		name     string
+		channels channelLookup
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "named channel",
+			channels: stubChannels(&discordgo.Channel{ID: "20", Name: "general"}, nil),
+			want:     map[string]string{"join": ":wave: looks like nick just joined general", "leave": "nick just left general", "batch": ":wave: looks like nick just joined general"},
+		},
+		{
+			name:     "unnamed channel falls back to the id",
+			channels: stubChannels(&discordgo.Channel{ID: "20"}, nil),
+			want:     map[string]string{"join": ":wave: looks like nick just joined 20", "leave": "nick just left 20", "batch": ":wave: looks like nick just joined 20"},
+		},
+		{
+			name:     "failing lookup",
+			channels: stubChannels(nil, errors.New("unknown channel")),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		for kind, fn := range build {
+			t.Run(tt.name+"/"+kind, func(t *testing.T) {
+				got, err := fn(tt.channels)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got != tt.want[kind] {
+					t.Errorf("message = %q, want %q", got, tt.want[kind])
+				}
+			})
+		}
+	}
+}
+
+func TestRenderNotification(t *testing.T) {
+	channel := &discordgo.Channel{ID: "20", Name: "general"}
+	alice := &discordgo.Member{Nick: "Alice", User: &discordgo.User{Username: "alice"}}
+	bob := &discordgo.Member{User: &discordgo.User{Username: "bob"}}
+	tests := []struct {
+		name     string
+		template string
+		members  []*discordgo.Member
+		want     string
+	}{
+		{
+			name:    "no template",
+			members: []*discordgo.Member{alice},
+			want:    ":wave: looks like Alice just joined general",
+		},
+		{
+			name:     "template",
+			template: "{{.Emoji}} {{.Nick}} ({{.Username}}) hopped into {{.ChannelName}}",
+			members:  []*discordgo.Member{alice},
+			want:     ":wave: Alice (alice) hopped into general",
+		},
+		{
+			name:     "batched template",
+			template: "{{.Nick}} joined {{.ChannelName}}{{range .Names}} [{{.}}]{{end}}",
+			members:  []*discordgo.Member{alice, bob},
+			want:     "Alice and bob joined general [Alice] [bob]",
+		},
+		{
+			name:     "render failure falls back",
+			template: "{{.Missing}}",
+			members:  []*discordgo.Member{alice},
+			want:     ":wave: looks like Alice just joined general",
+		},
+		{
+			name:     "parse failure falls back",
+			template: "{{.Nick",
+			members:  []*discordgo.Member{alice, bob},
+			want:     ":wave: looks like Alice and bob just joined general",
+		},
+	}
+	guilds := &fakeGuilds{guilds: map[string]*discordgo.Guild{"1": {ID: "1"}}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := registerGuild(guilds, &discordgo.Guild{ID: "1"}, config{EmojiID: ":wave:", NotificationTemplate: tt.template}, discardLogger)
+			if err != nil {
+				t.Fatalf("registerGuild() error = %v", err)
+			}
+			if got := renderNotification(c, tt.members, channel, discardLogger); got != tt.want {
+				t.Errorf("renderNotification() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCooldownsArePerGuild(t *testing.T) {
+	cooldowns, err := loadCooldownStore(filepath.Join(t.TempDir(), "cooldowns.json"), discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutes, err := loadCooldownStore(filepath.Join(t.TempDir(), "mutes.json"), discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cooldowns.Start(cooldownKey("A", "100"), time.Hour)
+	if cooldowns.Active(cooldownKey("B", "100")) {
+		t.Fatal("a cooldown in guild A suppresses guild B")
+	}
+
+	state := discordgo.NewState()
+	for _, guildID := range []string{"A", "B"} {
+		if err := state.GuildAdd(&discordgo.Guild{ID: guildID}); err != nil {
+			t.Fatal(err)
+		}
+		if err := state.PresenceAdd(guildID, &discordgo.Presence{User: &discordgo.User{ID: "100"}, Status: discordgo.StatusOnline}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &discordgo.Session{State: state}
+	c := config{requiredRoleID: "10"}
+	noon := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.Local)
+	join := func(guildID string) *discordgo.VoiceStateUpdate {
+		return &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{
+			GuildID: guildID,
+			UserID:  "100",
+			Member:  &discordgo.Member{User: &discordgo.User{ID: "100"}, Roles: []string{"10"}},
+		}}
+	}
+
+	if shouldNotify(s, join("A"), discardLogger, c, cooldowns, mutes, noon) {
+		t.Error("shouldNotify() = true in guild A, want the cooldown to suppress it")
+	}
+	if !shouldNotify(s, join("B"), discardLogger, c, cooldowns, mutes, noon) {
+		t.Error("shouldNotify() = false in guild B, want guild A's cooldown not to apply")
+	}
+}
+
+func TestIsLeave(t *testing.T) {
+	tests := []struct {
+		name   string
+		before *discordgo.VoiceState
+		after  *discordgo.VoiceState
+		want   bool
+	}{
+		{name: "disconnect", before: &discordgo.VoiceState{ChannelID: "20"}, after: &discordgo.VoiceState{}, want: true},
+		{name: "mute", before: &discordgo.VoiceState{ChannelID: "20"}, after: &discordgo.VoiceState{ChannelID: "20", SelfMute: true}},
+		{name: "deafen", before: &discordgo.VoiceState{ChannelID: "20", SelfMute: true}, after: &discordgo.VoiceState{ChannelID: "20", SelfMute: true, SelfDeaf: true}},
+		{name: "channel move", before: &discordgo.VoiceState{ChannelID: "20"}, after: &discordgo.VoiceState{ChannelID: "30"}},
+		{name: "first join", after: &discordgo.VoiceState{ChannelID: "20"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vs := &discordgo.VoiceStateUpdate{VoiceState: tt.after, BeforeUpdate: tt.before}
+			if got := isLeave(vs); got != tt.want {
+				t.Errorf("isLeave() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// guildMetrics counts what the bot has done in a guild since it started
+type guildMetrics struct {
+	JoinNotifications  atomic.Int64
+	LeaveNotifications atomic.Int64
+	RoleOptIns         atomic.Int64
+	RoleOptOuts        atomic.Int64
+}
+
+// metrics is an in-memory set of counters keyed by guild ID
+type metrics struct {
+	guilds sync.Map
+}
+
+func (m *metrics) Guild(guildID string) *guildMetrics {
+	g, _ := m.guilds.LoadOrStore(guildID, &guildMetrics{})
+	return g.(*guildMetrics)
+}
+
+func (g *guildMetrics) String() string {
+	return fmt.Sprintf("Join notifications sent: %d\nLeave notifications sent: %d\nRole opt-ins: %d\nRole opt-outs: %d",
+		g.JoinNotifications.Load(), g.LeaveNotifications.Load(), g.RoleOptIns.Load(), g.RoleOptOuts.Load())
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// indefiniteMute stands in for "until unmuted" since mutes share the expiring cooldownStore
+const indefiniteMute = 100 * 365 * 24 * time.Hour
+
+// maxMuteMinutes caps the minutes option at a year, anything longer is what leaving it empty is for
+const maxMuteMinutes = 365 * 24 * 60
+
+var muteOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        "minutes",
+		Description: "how long to stay muted, leave empty to stay muted until /unmute-notifications",
+		MinValue:    &[]float64{1}[0],
+		MaxValue:    maxMuteMinutes,
+	},
+}
+
+// muteHandler suppresses the invoking user's voice notifications without giving up the opt-in role
+func muteHandler(s interactionResponder, mutes *cooldownStore, logger *slog.Logger) func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+	return func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+		d, reply := indefiniteMute, "Thy arrivals shall go unannounced until thou /unmute-notifications"
+		for _, opt := range i.ApplicationCommandData().Options {
+			if opt.Name == "minutes" {
+				minutes := opt.IntValue()
+				d = muteDuration(minutes)
+				unit := "minutes"
+				if minutes == 1 {
+					unit = "minute"
+				}
+				reply = fmt.Sprintf("Thy arrivals shall go unannounced for %d %s", minutes, unit)
+			}
+		}
+
+		mutes.Start(cooldownKey(i.GuildID, interactionUserID(i)), d)
+		if err := mutes.Save(); err != nil {
+			logger.Error("could not save mutes", slog.String("err", err.Error()), slog.String("guild", i.GuildID))
+		}
+		respondEphemeral(s, i, reply)
+	}
+}
+
+// muteDuration converts the minutes option, clamping it to indefiniteMute so an out of range value discord didn't
+// reject can't overflow the duration into the past
+func muteDuration(minutes int64) time.Duration {
+	if minutes < 1 {
+		return time.Minute
+	}
+	if minutes > int64(indefiniteMute/time.Minute) {
+		return indefiniteMute
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func unmuteHandler(s interactionResponder, mutes *cooldownStore, logger *slog.Logger) func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+	return func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+		mutes.Clear(cooldownKey(i.GuildID, interactionUserID(i)))
+		if err := mutes.Save(); err != nil {
+			logger.Error("could not save mutes", slog.String("err", err.Error()), slog.String("guild", i.GuildID))
+		}
+		respondEphemeral(s, i, "Thy arrivals shall be announced once more")
+	}
+}
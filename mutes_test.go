@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMuteDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		minutes int64
+		want    time.Duration
+	}{
+		{name: "minutes", minutes: 30, want: 30 * time.Minute},
+		{name: "option maximum", minutes: maxMuteMinutes, want: maxMuteMinutes * time.Minute},
+		{name: "past indefinite", minutes: int64(indefiniteMute/time.Minute) + 1, want: indefiniteMute},
+		{name: "would overflow", minutes: math.MaxInt64, want: indefiniteMute},
+		{name: "below minimum", minutes: -5, want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := muteDuration(tt.minutes); got != tt.want {
+				t.Errorf("muteDuration(%d) = %v, want %v", tt.minutes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMuteHandlers(t *testing.T) {
+	s := &fakeSession{}
+	mutes, err := loadCooldownStore(filepath.Join(t.TempDir(), "mutes.json"), discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := cooldownKey("1", "100")
+	minutes := []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "minutes", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(30)},
+	}
+
+	muteHandler(s, mutes, discardLogger)(nil, testInteraction(discordgo.InteractionApplicationCommand, discordgo.ApplicationCommandInteractionData{Options: minutes}, 0))
+	if !mutes.Active(key) || mutes.expires[key].After(time.Now().Add(30*time.Minute)) {
+		t.Errorf("mute expires at %v, want within 30 minutes", mutes.expires[key])
+	}
+
+	muteHandler(s, mutes, discardLogger)(nil, testInteraction(discordgo.InteractionApplicationCommand, discordgo.ApplicationCommandInteractionData{}, 0))
+	if !mutes.expires[key].After(time.Now().Add(indefiniteMute - time.Minute)) {
+		t.Errorf("mute without minutes expires at %v, want indefinite", mutes.expires[key])
+	}
+
+	unmuteHandler(s, mutes, discardLogger)(nil, testInteraction(discordgo.InteractionApplicationCommand, nil, 0))
+	if mutes.Active(key) {
+		t.Error("unmute left the user muted")
+	}
+
+	want := []string{
+		"Thy arrivals shall go unannounced for 30 minutes",
+		"Thy arrivals shall go unannounced until thou /unmute-notifications",
+		"Thy arrivals shall be announced once more",
+	}
+	if !slices.Equal(s.responses, want) {
+		t.Errorf("replied %q, want %q", s.responses, want)
+	}
+}
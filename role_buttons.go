@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// roleButtonPrefix marks the custom IDs of role menu buttons, the role ID follows it
+const roleButtonPrefix = "role-toggle:"
+
+// roleEditor answers interactions by changing the invoking member's roles
+type roleEditor interface {
+	interactionResponder
+	GuildMemberRoleAdd(guildID, userID, roleID string, options ...discordgo.RequestOption) error
+	GuildMemberRoleRemove(guildID, userID, roleID string, options ...discordgo.RequestOption) error
+}
+
+// messagePoster answers interactions and posts messages of its own
+type messagePoster interface {
+	interactionResponder
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+// optInHandler grants the configured role to the invoking member
+func optInHandler(s roleEditor, cfg *botConfig, stats *metrics, logger *slog.Logger) func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+	return func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+		if err := s.GuildMemberRoleAdd(i.GuildID, interactionUserID(i), cfg.requiredRoleID(i.GuildID)); err != nil {
+			logger.Error("could not add role to user", slog.String("err", err.Error()), slog.String("guild", i.GuildID), slog.String("user", interactionUser(i).Username))
+			return
+		}
+
+		stats.Guild(i.GuildID).RoleOptIns.Add(1)
+		respondEphemeral(s, i, "Thou hast been granted \"hello-there\"")
+	}
+}
+
+// optOutHandler takes the configured role away from the invoking member
+func optOutHandler(s roleEditor, cfg *botConfig, stats *metrics, logger *slog.Logger) func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+	return func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+		if err := s.GuildMemberRoleRemove(i.GuildID, interactionUserID(i), cfg.requiredRoleID(i.GuildID)); err != nil {
+			logger.Error("could not add role to user", slog.String("err", err.Error()), slog.String("guild", i.GuildID), slog.String("user", interactionUser(i).Username))
+			return
+		}
+
+		stats.Guild(i.GuildID).RoleOptOuts.Add(1)
+		respondEphemeral(s, i, "Thou hast had thy privileges revoked")
+	}
+}
+
+// postRoleMenuHandler posts a message with a button per configured role so members can opt in without slash commands
+func postRoleMenuHandler(s messagePoster, cfg *botConfig, logger *slog.Logger) func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+	return func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+		if i.Member.Permissions&discordgo.PermissionManageRoles == 0 {
+			respondEphemeral(s, i, "Only members who can manage roles may post the role menu")
+			return
+		}
+
+		c, _ := cfg.Get(i.GuildID)
+		if c.requiredRoleID == "" {
+			respondEphemeral(s, i, "No roles are configured for this server")
+			return
+		}
+
+		_, err := s.ChannelMessageSendComplex(i.ChannelID, &discordgo.MessageSend{
+			Content: "Click a button to toggle the role",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    c.RequiredRoleName,
+							Style:    discordgo.SecondaryButton,
+							CustomID: roleButtonPrefix + c.requiredRoleID,
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			logger.Error("could not post role menu", slog.String("err", err.Error()), slog.String("guild", i.GuildID), slog.String("channel", i.ChannelID))
+			respondEphemeral(s, i, "Could not post the role menu")
+			return
+		}
+
+		respondEphemeral(s, i, "Role menu posted")
+	}
+}
+
+// roleButtonHandler toggles the role encoded in the clicked button's custom ID for the clicking member
+func roleButtonHandler(s roleEditor, cfg *botConfig, stats *metrics, logger *slog.Logger) func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+	return func(_ *discordgo.Session, i *discordgo.InteractionCreate) {
+		roleID := strings.TrimPrefix(i.MessageComponentData().CustomID, roleButtonPrefix)
+		//only configured roles can be toggled, whatever the button says
+		if roleID == "" || roleID != cfg.requiredRoleID(i.GuildID) {
+			respondEphemeral(s, i, "That role can't be assigned here")
+			return
+		}
+
+		logger := logger.With(slog.String("guild", i.GuildID), slog.String("user", interactionUser(i).Username), slog.String("role", roleID))
+		if slices.Contains(i.Member.Roles, roleID) {
+			if err := s.GuildMemberRoleRemove(i.GuildID, interactionUserID(i), roleID); err != nil {
+				logger.Error("could not remove role from user", slog.String("err", err.Error()))
+				respondEphemeral(s, i, "Could not remove the role")
+				return
+			}
+			stats.Guild(i.GuildID).RoleOptOuts.Add(1)
+			respondEphemeral(s, i, "Role removed")
+			return
+		}
+
+		if err := s.GuildMemberRoleAdd(i.GuildID, interactionUserID(i), roleID); err != nil {
+			logger.Error("could not add role to user", slog.String("err", err.Error()))
+			respondEphemeral(s, i, "Could not add the role")
+			return
+		}
+		stats.Guild(i.GuildID).RoleOptIns.Add(1)
+		respondEphemeral(s, i, "Role added")
+	}
+}
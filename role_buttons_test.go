@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeSession records what handlers ask discord to do, err fails every role change and message
+type fakeSession struct {
+	responses []string
+	added     []string
+	removed   []string
+	sent      []*discordgo.MessageSend
+	err       error
+}
+
+func (f *fakeSession) InteractionRespond(_ *discordgo.Interaction, resp *discordgo.InteractionResponse, _ ...discordgo.RequestOption) error {
+	f.responses = append(f.responses, resp.Data.Content)
+	return nil
+}
+
+func (f *fakeSession) GuildMemberRoleAdd(_, _, roleID string, _ ...discordgo.RequestOption) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.added = append(f.added, roleID)
+	return nil
+}
+
+func (f *fakeSession) GuildMemberRoleRemove(_, _, roleID string, _ ...discordgo.RequestOption) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.removed = append(f.removed, roleID)
+	return nil
+}
+
+func (f *fakeSession) ChannelMessageSendComplex(_ string, data *discordgo.MessageSend, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.sent = append(f.sent, data)
+	return &discordgo.Message{}, nil
+}
+
+func testRoleConfig() *botConfig {
+	return &botConfig{guilds: map[string]config{
+		"1": {RequiredRoleName: "hello-there", requiredRoleID: "10"},
+	}}
+}
+
+func testInteraction(typ discordgo.InteractionType, data discordgo.InteractionData, perms int64, roles ...string) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type:    typ,
+		GuildID: "1",
+		Data:    data,
+		Member:  &discordgo.Member{User: &discordgo.User{ID: "100", Username: "alice"}, Roles: roles, Permissions: perms},
+	}}
+}
+
+func TestOptInOutHandlers(t *testing.T) {
+	tests := []struct {
+		name        string
+		optIn       bool
+		err         error
+		wantAdded   []string
+		wantRemoved []string
+		wantReplies []string
+	}{
+		{name: "opt in", optIn: true, wantAdded: []string{"10"}, wantReplies: []string{"Thou hast been granted \"hello-there\""}},
+		{name: "opt out", wantRemoved: []string{"10"}, wantReplies: []string{"Thou hast had thy privileges revoked"}},
+		{name: "opt in fails", optIn: true, err: errors.New("missing access")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeSession{err: tt.err}
+			stats := &metrics{}
+			h := optOutHandler(s, testRoleConfig(), stats, discardLogger)
+			if tt.optIn {
+				h = optInHandler(s, testRoleConfig(), stats, discardLogger)
+			}
+
+			h(nil, testInteraction(discordgo.InteractionApplicationCommand, nil, 0))
+			if !slices.Equal(s.added, tt.wantAdded) || !slices.Equal(s.removed, tt.wantRemoved) {
+				t.Errorf("added %v removed %v, want added %v removed %v", s.added, s.removed, tt.wantAdded, tt.wantRemoved)
+			}
+			if !slices.Equal(s.responses, tt.wantReplies) {
+				t.Errorf("replied %q, want %q", s.responses, tt.wantReplies)
+			}
+			if got := stats.Guild("1").RoleOptIns.Load() + stats.Guild("1").RoleOptOuts.Load(); got != int64(len(tt.wantReplies)) {
+				t.Errorf("counted %d role changes, want %d", got, len(tt.wantReplies))
+			}
+		})
+	}
+}
+
+func TestRoleButtonHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		customID    string
+		roles       []string
+		err         error
+		wantAdded   []string
+		wantRemoved []string
+		wantReply   string
+	}{
+		{name: "adds a missing role", customID: roleButtonPrefix + "10", wantAdded: []string{"10"}, wantReply: "Role added"},
+		{name: "removes a held role", customID: roleButtonPrefix + "10", roles: []string{"10"}, wantRemoved: []string{"10"}, wantReply: "Role removed"},
+		{name: "unconfigured role", customID: roleButtonPrefix + "20", wantReply: "That role can't be assigned here"},
+		{name: "empty role", customID: roleButtonPrefix, wantReply: "That role can't be assigned here"},
+		{name: "add fails", customID: roleButtonPrefix + "10", err: errors.New("missing access"), wantReply: "Could not add the role"},
+		{name: "remove fails", customID: roleButtonPrefix + "10", roles: []string{"10"}, err: errors.New("missing access"), wantReply: "Could not remove the role"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeSession{err: tt.err}
+			h := roleButtonHandler(s, testRoleConfig(), &metrics{}, discardLogger)
+
+			h(nil, testInteraction(discordgo.InteractionMessageComponent, discordgo.MessageComponentInteractionData{CustomID: tt.customID}, 0, tt.roles...))
+			if !slices.Equal(s.added, tt.wantAdded) || !slices.Equal(s.removed, tt.wantRemoved) {
+				t.Errorf("added %v removed %v, want added %v removed %v", s.added, s.removed, tt.wantAdded, tt.wantRemoved)
+			}
+			if !slices.Equal(s.responses, []string{tt.wantReply}) {
+				t.Errorf("replied %q, want %q", s.responses, tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestPostRoleMenuHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		perms        int64
+		guildID      string
+		err          error
+		wantCustomID string
+		wantReply    string
+	}{
+		{name: "posts the menu", perms: discordgo.PermissionManageRoles, guildID: "1", wantCustomID: roleButtonPrefix + "10", wantReply: "Role menu posted"},
+		{name: "needs manage roles", guildID: "1", wantReply: "Only members who can manage roles may post the role menu"},
+		{name: "no role configured", perms: discordgo.PermissionManageRoles, guildID: "2", wantReply: "No roles are configured for this server"},
+		{name: "send fails", perms: discordgo.PermissionManageRoles, guildID: "1", err: errors.New("missing access"), wantReply: "Could not post the role menu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeSession{err: tt.err}
+			i := testInteraction(discordgo.InteractionApplicationCommand, nil, tt.perms)
+			i.GuildID = tt.guildID
+
+			postRoleMenuHandler(s, testRoleConfig(), discardLogger)(nil, i)
+			if !slices.Equal(s.responses, []string{tt.wantReply}) {
+				t.Errorf("replied %q, want %q", s.responses, tt.wantReply)
+			}
+			if tt.wantCustomID == "" {
+				if len(s.sent) != 0 {
+					t.Errorf("posted %d messages, want none", len(s.sent))
+				}
+				return
+			}
+			if len(s.sent) != 1 {
+				t.Fatalf("posted %d messages, want 1", len(s.sent))
+			}
+			button := s.sent[0].Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+			if button.CustomID != tt.wantCustomID {
+				t.Errorf("button custom ID = %q, want %q", button.CustomID, tt.wantCustomID)
+			}
+		})
+	}
+}
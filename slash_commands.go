@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandGroup sections the /help listing, groups are listed in declaration order
+type commandGroup int
+
+const (
+	groupVoice commandGroup = iota
+	groupAdmin
+)
+
+func (g commandGroup) String() string {
+	switch g {
+	case groupVoice:
+		return "Voice notifications"
+	case groupAdmin:
+		return "Server tools"
+	default:
+		return "Other"
+	}
+}
+
+type slashCommand struct {
+	Description string
+	Group       commandGroup
+	//Permissions restricts who discord shows the command to, zero means everyone
+	Permissions int64
+	Options     []*discordgo.ApplicationCommandOption
+	Handler     func(s *discordgo.Session, i *discordgo.InteractionCreate)
+}
+
+type slashCommands map[string]slashCommand
+
+func (c slashCommand) applicationCommand(name string) *discordgo.ApplicationCommand {
+	dmPermission := false
+	cmd := &discordgo.ApplicationCommand{Name: name, Description: c.Description, Options: c.Options, DMPermission: &dmPermission}
+	if c.Permissions != 0 {
+		cmd.DefaultMemberPermissions = &c.Permissions
+	}
+	return cmd
+}
+
+// sortedNames returns the command names ordered by group and then name so listings are stable
+func (c slashCommands) sortedNames() []string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if c[a].Group != c[b].Group {
+			return int(c[a].Group) - int(c[b].Group)
+		}
+		return strings.Compare(a, b)
+	})
+	return names
+}
+
+func (c slashCommands) helpText() string {
+	b := strings.Builder{}
+	names := c.sortedNames()
+	for idx, name := range names {
+		cmd := c[name]
+		if idx == 0 || c[names[idx-1]].Group != cmd.Group {
+			b.WriteString("**" + cmd.Group.String() + "**\n")
+		}
+		b.WriteString("`/" + name + "` " + cmd.Description + "\n")
+	}
+	return b.String()
+}
+
+// helpHandler lists c, which is read when the command runs so commands added after this is built still show up
+func helpHandler(c slashCommands) func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		respondEphemeral(s, i, c.helpText())
+	}
+}
+
+// applicationID prefers the application from the ready event. For bots it matches the user ID, which is the fallback.
+func applicationID(s *discordgo.Session) string {
+	if s.State.Application != nil && s.State.Application.ID != "" {
+		return s.State.Application.ID
+	}
+	return s.State.User.ID
+}
+
+// commandOverwriter replaces an application's commands in one scope with a new set
+type commandOverwriter interface {
+	ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error)
+}
+
+// CreateCommands replaces the guild's commands with c in a single call, which also drops any stale commands
+func (c slashCommands) CreateCommands(s commandOverwriter, appID, guildID string) error {
+	names := c.sortedNames()
+	cmds := make([]*discordgo.ApplicationCommand, 0, len(names))
+	for _, name := range names {
+		cmds = append(cmds, c[name].applicationCommand(name))
+	}
+	_, err := s.ApplicationCommandBulkOverwrite(appID, guildID, cmds)
+	return err
+}
+
+// globalGuildID is the guild ID discord uses for commands that apply everywhere
+const globalGuildID = ""
+
+// SyncCommands registers c either globally or in each guild and clears the other scope so no command shows up twice.
+// Global commands reach guilds the bot joins later without a config change, but discord can take up to an hour to
+// propagate changes to them. Guild commands update instantly, which is why they are the default.
+func (c slashCommands) SyncCommands(s commandOverwriter, appID string, guildIDs []string, global bool) error {
+	guildScope, globalScope := c, slashCommands{}
+	if global {
+		guildScope, globalScope = globalScope, guildScope
+	}
+
+	errs := []error{globalScope.CreateCommands(s, appID, globalGuildID)}
+	for _, guildID := range guildIDs {
+		errs = append(errs, guildScope.CreateCommands(s, appID, guildID))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var testCommands = slashCommands{
+	"stats":      {Description: "shows stats", Group: groupAdmin},
+	"voice-spam": {Description: "opts in", Group: groupVoice},
+	"bot-perms":  {Description: "shows perms", Group: groupAdmin},
+	"no-spam":    {Description: "opts out", Group: groupVoice},
+}
+
+func TestSortedNames(t *testing.T) {
+	want := []string{"no-spam", "voice-spam", "bot-perms", "stats"}
+	if got := testCommands.sortedNames(); !slices.Equal(got, want) {
+		t.Errorf("sortedNames() = %v, want %v", got, want)
+	}
+}
+
+func TestHelpText(t *testing.T) {
+	want := "**Voice notifications**\n" +
+		"`/no-spam` opts out\n" +
+		"`/voice-spam` opts in\n" +
+		"**Server tools**\n" +
+		"`/bot-perms` shows perms\n" +
+		"`/stats` shows stats\n"
+	if got := testCommands.helpText(); got != want {
+		t.Errorf("helpText() = %q, want %q", got, want)
+	}
+}
+
+// fakeOverwriter records each bulk overwrite as the guild ID and the command names sent to it
+type fakeOverwriter struct {
+	appIDs []string
+	calls  map[string][]string
+}
+
+func (f *fakeOverwriter) ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, _ ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+	f.appIDs = append(f.appIDs, appID)
+	names := []string{}
+	for _, c := range commands {
+		names = append(names, c.Name)
+	}
+	f.calls[guildID] = names
+	return commands, nil
+}
+
+func TestSyncCommands(t *testing.T) {
+	all := testCommands.sortedNames()
+	tests := []struct {
+		name   string
+		global bool
+		want   map[string][]string
+	}{
+		{
+			name: "guild",
+			want: map[string][]string{globalGuildID: {}, "1": all, "2": all},
+		},
+		{
+			name:   "global",
+			global: true,
+			want:   map[string][]string{globalGuildID: all, "1": {}, "2": {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeOverwriter{calls: map[string][]string{}}
+			if err := testCommands.SyncCommands(s, "app", []string{"1", "2"}, tt.global); err != nil {
+				t.Fatalf("SyncCommands() error = %v", err)
+			}
+			if len(s.calls) != len(tt.want) {
+				t.Errorf("SyncCommands() overwrote %v, want %v", s.calls, tt.want)
+			}
+			for guildID, want := range tt.want {
+				if got, ok := s.calls[guildID]; !ok || !slices.Equal(got, want) {
+					t.Errorf("guild %q got commands %v, want %v", guildID, got, want)
+				}
+			}
+			for _, appID := range s.appIDs {
+				if appID != "app" {
+					t.Errorf("overwrote commands for app %q, want %q", appID, "app")
+				}
+			}
+		})
+	}
+}